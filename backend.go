@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+)
+
+// Backend is the storage abstraction Store delegates byte-level reads and
+// writes to. Each implementation owns its own PathTransformFunc and maps
+// id/PathKey.FullPath() onto wherever it actually keeps bytes, so callers
+// can swap disk, S3, or memory without touching CAS or networking code.
+type Backend interface {
+	Has(id string, key string) bool
+	Write(id string, key string, r io.Reader) (int64, error)
+	WriteDecrypt(encKey []byte, id string, key string, r io.Reader) (int64, error)
+	Read(id string, key string) (int64, io.Reader, error)
+	Delete(id string, key string) error
+	Verify(id string, key string) error
+
+	// Link publishes name as a mutable pointer at the content-addressed
+	// key, Unlink removes it, Resolve looks up the key a name currently
+	// points to, and ListRefs enumerates every name published for id.
+	Link(id string, name string, key string) error
+	Unlink(id string, name string) error
+	Resolve(id string, name string) (string, error)
+	ListRefs(id string) ([]string, error)
+}
+
+// ErrHashMismatch is returned when a blob's content does not hash to the
+// key it was stored (or expected to be found) under.
+var ErrHashMismatch = errors.New("content does not hash to the given key")
+
+// ErrRefNotFound is returned when Resolve or Unlink is given a name with
+// no ref published for it.
+var ErrRefNotFound = errors.New("ref not found")
+
+// hashFuncBackend is implemented by every Backend so Store.hashFunc can
+// derive a content key using whatever hash algorithm the actual,
+// currently-configured backend expects, rather than re-deriving it from
+// StoreOpts fields that can diverge from it (e.g. when a pre-built
+// Backend is handed to NewStore directly via StoreOpts.Backend).
+type hashFuncBackend interface {
+	hashFunc() func() hash.Hash
+}
+
+// validateRefName rejects ref names that could escape a backend's refs
+// directory (or object prefix) once interpolated into a path: empty
+// names, ".", "..", and anything containing a path separator. Every
+// Backend builds its ref storage location directly from name, so this is
+// the single choke point Store.Link/Unlink/Resolve call before any
+// backend ever sees an untrusted name.
+func validateRefName(name string) error {
+	if name == "" || name == "." || name == ".." {
+		return fmt.Errorf("ref name %q is not valid", name)
+	}
+	if strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("ref name %q must not contain a path separator", name)
+	}
+	return nil
+}
+
+// verifyDigest hashes r with hashFunc and reports ErrHashMismatch if the
+// resulting hex digest isn't key. It's shared by every Backend's Verify.
+func verifyDigest(r io.Reader, key string, hashFunc func() hash.Hash) error {
+	h := hashFunc()
+	if _, err := io.Copy(h, r); err != nil {
+		return err
+	}
+
+	if hex.EncodeToString(h.Sum(nil)) != key {
+		return ErrHashMismatch
+	}
+
+	return nil
+}
+
+// hashFuncFor returns the hash algorithm transform's keys are digests
+// under, when transform is CAS-shaped (built by NewCASPathTransformFunc,
+// per casOptionsFor), falling back to sha1 for a plain
+// DefaultPathTransformFunc-style transform, where the key is just a
+// filename rather than a hash. It's shared by MemoryBackend's and
+// S3Backend's Verify, and by verifyIfCAS, so their write-time and
+// read-time integrity checks agree on which hash a given backend's keys
+// are expected to satisfy. FSBackend uses its own verifyHashFunc.
+func hashFuncFor(transform PathTransformFunc) func() hash.Hash {
+	if opts, ok := casOptionsFor(transform); ok {
+		if hashFunc, ok := hashFuncsByName[opts.HashName]; ok {
+			return hashFunc
+		}
+	}
+	return sha1.New
+}
+
+// verifyIfCAS checks data against key at write time, but only when
+// transform is CAS-shaped (built by NewCASPathTransformFunc, per
+// casOptionsFor) — i.e. only when key is actually meant to be a content
+// hash. A plain DefaultPathTransformFunc-style transform, where the key is
+// just a filename, is left unverified. It's shared by MemoryBackend and
+// S3Backend so every Backend enforces write-time integrity the same way
+// FSBackend's atomicWrite does.
+func verifyIfCAS(transform PathTransformFunc, key string, data []byte) error {
+	if _, ok := casOptionsFor(transform); !ok {
+		return nil
+	}
+
+	h := hashFuncFor(transform)()
+	h.Write(data)
+	if hex.EncodeToString(h.Sum(nil)) != key {
+		return ErrHashMismatch
+	}
+
+	return nil
+}
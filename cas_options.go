@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// casMetaFileName is the small file FSBackend drops at a store's disk
+// root recording the CASPathOptions its shard tree was built with, so a
+// process started with different defaults still reads/writes under the
+// layout already on disk.
+const casMetaFileName = "cas_meta.json"
+
+// CASPathOptions configures how NewCASPathTransformFunc shards a hash
+// into nested directories: Depth controls how many directories deep a
+// blob sits, DirNameLen controls how many hex characters each directory
+// name takes from the hash. HashName selects the hash algorithm and must
+// be a key of hashFuncsByName.
+type CASPathOptions struct {
+	HashName   string `json:"hashName"`
+	Depth      int    `json:"depth"`
+	DirNameLen int    `json:"dirNameLen"`
+}
+
+var hashFuncsByName = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+}
+
+// casTransformsMu guards casTransforms, the registry NewCASPathTransformFunc
+// populates so callers holding only a PathTransformFunc value (FSBackend,
+// MemoryBackend, S3Backend) can still recover the CASPathOptions it was
+// built from; see casOptionsFor.
+var (
+	casTransformsMu sync.Mutex
+	casTransforms   = make(map[uintptr]CASPathOptions)
+)
+
+// casOptionsFor reports whether fn was produced by NewCASPathTransformFunc
+// (directly or via CASPathTransformFunc), returning the CASPathOptions it
+// was built with. It's how backends decide whether a key is meant to be a
+// content hash worth verifying, without requiring every caller to thread
+// CASPathOptions through by hand.
+func casOptionsFor(fn PathTransformFunc) (CASPathOptions, bool) {
+	casTransformsMu.Lock()
+	defer casTransformsMu.Unlock()
+
+	opts, ok := casTransforms[reflect.ValueOf(fn).Pointer()]
+	return opts, ok
+}
+
+func (o CASPathOptions) withDefaults() CASPathOptions {
+	if o.HashName == "" {
+		o.HashName = "sha1"
+	}
+	if o.Depth == 0 {
+		o.Depth = 8
+	}
+	if o.DirNameLen == 0 {
+		o.DirNameLen = 5
+	}
+	return o
+}
+
+func (o CASPathOptions) validate() error {
+	hashFunc, ok := hashFuncsByName[o.HashName]
+	if !ok {
+		return fmt.Errorf("cas path options: unknown hash %q", o.HashName)
+	}
+
+	if o.Depth < 1 {
+		return fmt.Errorf("cas path options: depth (%d) must be at least 1", o.Depth)
+	}
+	if o.DirNameLen < 1 {
+		return fmt.Errorf("cas path options: dirNameLen (%d) must be at least 1", o.DirNameLen)
+	}
+
+	hashHexLen := hashFunc().Size() * 2
+	if o.Depth*o.DirNameLen > hashHexLen {
+		return fmt.Errorf("cas path options: depth*dirNameLen (%d) exceeds hash hex length (%d) for %s", o.Depth*o.DirNameLen, hashHexLen, o.HashName)
+	}
+
+	return nil
+}
+
+// NewCASPathTransformFunc builds a PathTransformFunc that shards a key's
+// hash into opts.Depth nested directories of opts.DirNameLen hex
+// characters each, hashing with opts.HashName (defaults to sha1).
+func NewCASPathTransformFunc(opts CASPathOptions) (PathTransformFunc, error) {
+	opts = opts.withDefaults()
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	hashFunc := hashFuncsByName[opts.HashName]
+
+	transform := func(key string) PathKey {
+		h := hashFunc()
+		h.Write([]byte(key))
+		hashStr := hex.EncodeToString(h.Sum(nil))
+
+		paths := make([]string, opts.Depth)
+		for i := 0; i < opts.Depth; i++ {
+			from, to := i*opts.DirNameLen, (i*opts.DirNameLen)+opts.DirNameLen
+			paths[i] = hashStr[from:to]
+		}
+
+		return PathKey{
+			Pathname: strings.Join(paths, "/"),
+			Filename: hashStr,
+		}
+	}
+
+	casTransformsMu.Lock()
+	casTransforms[reflect.ValueOf(PathTransformFunc(transform)).Pointer()] = opts
+	casTransformsMu.Unlock()
+
+	return transform, nil
+}
+
+// loadCASMetadata reads the CASPathOptions previously persisted at root,
+// returning nil if none has been written yet.
+func loadCASMetadata(root string) (*CASPathOptions, error) {
+	data, err := os.ReadFile(filepath.Join(root, casMetaFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var opts CASPathOptions
+	if err := json.Unmarshal(data, &opts); err != nil {
+		return nil, err
+	}
+
+	return &opts, nil
+}
+
+// saveCASMetadata persists opts at root so a later process pointed at the
+// same root reconstructs the same shard layout.
+func saveCASMetadata(root string, opts CASPathOptions) error {
+	if err := os.MkdirAll(root, os.ModePerm); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(opts)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(root, casMetaFileName), data, 0o644)
+}
@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestNewCASPathTransformFuncRejectsBadBounds(t *testing.T) {
+	cases := []CASPathOptions{
+		{HashName: "sha1", Depth: -1, DirNameLen: 5},
+		{HashName: "sha1", Depth: 5, DirNameLen: -2},
+	}
+
+	for _, opts := range cases {
+		if _, err := NewCASPathTransformFunc(opts); err == nil {
+			t.Errorf("NewCASPathTransformFunc(%+v): expected error, got nil", opts)
+		}
+	}
+}
+
+func TestNewCASPathTransformFuncRejectsOversizedShards(t *testing.T) {
+	_, err := NewCASPathTransformFunc(CASPathOptions{HashName: "sha1", Depth: 100, DirNameLen: 100})
+	if err == nil {
+		t.Fatal("expected error when depth*dirNameLen exceeds the hash hex length")
+	}
+}
+
+func TestNewStoreWiresCASOptionsIntoDefaultBackend(t *testing.T) {
+	opts := &CASPathOptions{HashName: "sha256", Depth: 2, DirNameLen: 2}
+	store, err := NewStore(StoreOpts{CASOptions: opts})
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+
+	backend, ok := store.Backend.(*FSBackend)
+	if !ok {
+		t.Fatalf("expected default backend to be *FSBackend, got %T", store.Backend)
+	}
+	if backend.CASOptions != opts {
+		t.Fatalf("expected FSBackend.CASOptions to be wired from StoreOpts.CASOptions")
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compressor lets a backend shrink a blob's on-disk footprint without
+// changing the key it's addressed by. Compress wraps a destination
+// writer, Decompress wraps a source reader back to the original bytes.
+type Compressor interface {
+	Compress(w io.Writer) io.WriteCloser
+	Decompress(r io.Reader) (io.Reader, error)
+	Name() string
+}
+
+// compressionHeaderLen is magic[4] | algoID[1] | origSize[8], written
+// ahead of every blob's (possibly compressed) body so a reader can tell
+// which Compressor to use and how large the decompressed content is
+// without decompressing it first.
+const compressionHeaderLen = 4 + 1 + 8
+
+var compressionMagic = [4]byte{'C', 'A', 'S', '1'}
+
+// compressorRegistry maps a Compressor to the single byte persisted as
+// its algoID; index in the slice is the ID, so entries must never be
+// reordered or removed once blobs have been written with them.
+var compressorRegistry = []Compressor{NoopCompressor{}, GzipCompressor{}, ZstdCompressor{}}
+
+func compressorID(c Compressor) (byte, bool) {
+	for i, registered := range compressorRegistry {
+		if registered.Name() == c.Name() {
+			return byte(i), true
+		}
+	}
+	return 0, false
+}
+
+func compressorByID(id byte) (Compressor, bool) {
+	if int(id) >= len(compressorRegistry) {
+		return nil, false
+	}
+	return compressorRegistry[id], true
+}
+
+func encodeCompressionHeader(algoID byte, origSize int64) []byte {
+	header := make([]byte, compressionHeaderLen)
+	copy(header[:4], compressionMagic[:])
+	header[4] = algoID
+	binary.BigEndian.PutUint64(header[5:], uint64(origSize))
+	return header
+}
+
+func decodeCompressionHeader(header []byte) (algoID byte, origSize int64, err error) {
+	if len(header) != compressionHeaderLen || string(header[:4]) != string(compressionMagic[:]) {
+		return 0, 0, errors.New("compressor: bad blob header")
+	}
+	algoID = header[4]
+	origSize = int64(binary.BigEndian.Uint64(header[5:]))
+	return algoID, origSize, nil
+}
+
+// multiCloser lets readStream return a single io.ReadCloser that closes
+// a decompressor before the underlying file it reads from.
+type multiCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (m *multiCloser) Close() error {
+	var firstErr error
+	for _, c := range m.closers {
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// NoopCompressor stores blobs as-is; it's the default so every blob
+// still carries the small header without paying for compression.
+type NoopCompressor struct{}
+
+func (NoopCompressor) Name() string { return "noop" }
+
+func (NoopCompressor) Compress(w io.Writer) io.WriteCloser {
+	return nopWriteCloser{w}
+}
+
+func (NoopCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	return r, nil
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// GzipCompressor compresses blobs with the standard library's gzip.
+type GzipCompressor struct{}
+
+func (GzipCompressor) Name() string { return "gzip" }
+
+func (GzipCompressor) Compress(w io.Writer) io.WriteCloser {
+	return gzip.NewWriter(w)
+}
+
+func (GzipCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	return gzip.NewReader(r)
+}
+
+// ZstdCompressor compresses blobs with zstd, which trades a bit of gzip's
+// ubiquity for noticeably better ratio and speed.
+type ZstdCompressor struct{}
+
+func (ZstdCompressor) Name() string { return "zstd" }
+
+func (ZstdCompressor) Compress(w io.Writer) io.WriteCloser {
+	enc, err := zstd.NewWriter(w)
+	if err != nil {
+		return errWriteCloser{err}
+	}
+	return enc
+}
+
+func (ZstdCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	dec, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return dec.IOReadCloser(), nil
+}
+
+type errWriteCloser struct{ err error }
+
+func (e errWriteCloser) Write(p []byte) (int, error) { return 0, e.err }
+func (e errWriteCloser) Close() error                { return e.err }
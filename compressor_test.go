@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCompressorsRoundTrip(t *testing.T) {
+	compressors := []Compressor{NoopCompressor{}, GzipCompressor{}, ZstdCompressor{}}
+	content := strings.Repeat("the quick brown fox jumps over the lazy dog ", 100)
+
+	for _, c := range compressors {
+		t.Run(c.Name(), func(t *testing.T) {
+			var buf bytes.Buffer
+			w := c.Compress(&buf)
+			if _, err := io.WriteString(w, content); err != nil {
+				t.Fatalf("Compress write: %v", err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Compress close: %v", err)
+			}
+
+			r, err := c.Decompress(&buf)
+			if err != nil {
+				t.Fatalf("Decompress: %v", err)
+			}
+			if rc, ok := r.(io.Closer); ok {
+				defer rc.Close()
+			}
+
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("ReadAll: %v", err)
+			}
+			if string(got) != content {
+				t.Fatalf("round trip mismatch: got %d bytes, want %d", len(got), len(content))
+			}
+		})
+	}
+}
+
+func TestFSBackendWriteReadRoundTripsUnderCompression(t *testing.T) {
+	for _, compressor := range []Compressor{GzipCompressor{}, ZstdCompressor{}} {
+		t.Run(compressor.Name(), func(t *testing.T) {
+			root := "network1:" + t.TempDir()
+			store, err := NewStore(StoreOpts{Root: root, Compressor: compressor})
+			if err != nil {
+				t.Fatalf("NewStore: %v", err)
+			}
+
+			content := strings.Repeat("compress me please ", 50)
+			if _, err := store.Write("id1", "key1", strings.NewReader(content)); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+
+			_, r, err := store.Read("id1", "key1")
+			if err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("ReadAll: %v", err)
+			}
+			if string(got) != content {
+				t.Fatalf("got %q, want %q", got, content)
+			}
+		})
+	}
+}
+
+func TestFSBackendWriteDecryptRoundTripsUnderCompression(t *testing.T) {
+	root := "network1:" + t.TempDir()
+	store, err := NewStore(StoreOpts{Root: root, Compressor: GzipCompressor{}})
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+
+	content := strings.Repeat("encrypted and compressed ", 50)
+	if _, err := store.WriteDecrypt(nil, "id1", "key1", strings.NewReader(content)); err != nil {
+		t.Fatalf("WriteDecrypt: %v", err)
+	}
+
+	_, r, err := store.Read("id1", "key1")
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if string(got) != content {
+		t.Fatalf("got %q, want %q", got, content)
+	}
+}
+
+func TestDecodeCompressionHeaderRejectsBadHeader(t *testing.T) {
+	cases := map[string][]byte{
+		"too short":   []byte("short"),
+		"bad magic":   append([]byte("XXXX"), make([]byte, 9)...),
+		"empty":       nil,
+		"truncated 1": []byte{'C', 'A', 'S', '1'},
+	}
+
+	for name, header := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := decodeCompressionHeader(header); err == nil {
+				t.Fatalf("decodeCompressionHeader(%v): expected error, got nil", header)
+			}
+		})
+	}
+}
@@ -0,0 +1,459 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"sync"
+)
+
+// FSBackend is the on-disk Backend implementation: it lays blobs out
+// under Root using PathTransformFunc, one CAS-sharded tree per id.
+//
+// If CASOptions is set, FSBackend ignores PathTransformFunc and instead
+// derives the transform from the CASPathOptions persisted at Root (see
+// cas_options.go): the first backend to touch a fresh Root writes its
+// effective options there, and every backend after that reloads them, so
+// a store keeps working even if it's reopened with different tuning.
+//
+// If Compressor is set, every blob is transparently compressed on write
+// and decompressed on read (see compressor.go); it defaults to
+// NoopCompressor, so blobs still carry the small format header even when
+// nothing is actually compressed.
+type FSBackend struct {
+	Root              string
+	PathTransformFunc PathTransformFunc
+	CASOptions        *CASPathOptions
+	Compressor        Compressor
+
+	locksMu sync.Mutex
+	locks   map[string]*sync.RWMutex
+}
+
+func (b *FSBackend) compressor() Compressor {
+	if b.Compressor != nil {
+		return b.Compressor
+	}
+	return NoopCompressor{}
+}
+
+// lockFor returns the in-process RWMutex guarding id/key, creating it on
+// first use. Writers take it exclusively around the whole atomicWrite so
+// two goroutines targeting the same content-address serialize instead of
+// clobbering each other's temp files; readers take it for shared access.
+func (b *FSBackend) lockFor(id string, key string) *sync.RWMutex {
+	b.locksMu.Lock()
+	defer b.locksMu.Unlock()
+
+	if b.locks == nil {
+		b.locks = make(map[string]*sync.RWMutex)
+	}
+
+	lockKey := id + "\x00" + key
+	lock, ok := b.locks[lockKey]
+	if !ok {
+		lock = &sync.RWMutex{}
+		b.locks[lockKey] = lock
+	}
+	return lock
+}
+
+func (b *FSBackend) diskRoot() (string, error) {
+	return diskRoot(b.Root)
+}
+
+func (b *FSBackend) transformFunc() (PathTransformFunc, error) {
+	if b.CASOptions == nil {
+		return b.PathTransformFunc, nil
+	}
+
+	root, err := b.diskRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := loadCASMetadata(root)
+	if err != nil {
+		return nil, err
+	}
+	if stored != nil {
+		return NewCASPathTransformFunc(*stored)
+	}
+
+	opts := b.CASOptions.withDefaults()
+	if err := saveCASMetadata(root, opts); err != nil {
+		return nil, err
+	}
+	return NewCASPathTransformFunc(opts)
+}
+
+func (b *FSBackend) Has(id string, key string) bool {
+	transform, err := b.transformFunc()
+	if err != nil {
+		log.Printf("cas path transform: %v", err)
+		return false
+	}
+
+	root, err := b.diskRoot()
+	if err != nil {
+		log.Printf("cas disk root: %v", err)
+		return false
+	}
+
+	pathKey := transform(key)
+	fullPathWithRoot := fmt.Sprintf("/%s/%s/%s", root, id, pathKey.FullPath())
+
+	_, err = os.Stat(fullPathWithRoot)
+	return !errors.Is(err, os.ErrNotExist)
+}
+
+// verifyHashFunc returns the hash algorithm used to check that a blob's
+// content actually hashes to its key, matching whatever hash the
+// effective CAS options use (sha1 when the store isn't CAS-sharded).
+func (b *FSBackend) verifyHashFunc(transform PathTransformFunc) func() hash.Hash {
+	if opts, ok := casOptionsFor(transform); ok {
+		if hashFunc, ok := hashFuncsByName[opts.HashName]; ok {
+			return hashFunc
+		}
+	}
+	if b.CASOptions != nil {
+		if hashFunc, ok := hashFuncsByName[b.CASOptions.withDefaults().HashName]; ok {
+			return hashFunc
+		}
+	}
+	return sha1.New
+}
+
+// hashFunc implements hashFuncBackend, reusing verifyHashFunc against the
+// backend's current effective transform so a caller like Store.WriteTree
+// hashes content the same way this backend verifies it, even when b was
+// pre-built and handed to NewStore directly. It falls back to sha1 if the
+// effective transform can't be determined right now (e.g. a CAS metadata
+// read failure), matching Has's treatment of the same error.
+func (b *FSBackend) hashFunc() func() hash.Hash {
+	transform, err := b.transformFunc()
+	if err != nil {
+		return sha1.New
+	}
+	return b.verifyHashFunc(transform)
+}
+
+// shouldVerifyWrite reports whether transform produces content-hash keys
+// worth checking at write time: either b.CASOptions was set explicitly, or
+// transform was built by NewCASPathTransformFunc (directly, or via the
+// package-level CASPathTransformFunc), per casOptionsFor. A plain
+// DefaultPathTransformFunc-style store, where the key is just a filename
+// rather than a hash, is left unverified.
+func (b *FSBackend) shouldVerifyWrite(transform PathTransformFunc) bool {
+	if b.CASOptions != nil {
+		return true
+	}
+	_, ok := casOptionsFor(transform)
+	return ok
+}
+
+// atomicWrite streams writeTo's output into a temp file under
+// <root>/<id>/tmp, hashing as it goes, then renames it into place at
+// PathKey.FullPath() once written. When the store is CAS-sharded it also
+// verifies the computed digest matches key before the rename, returning
+// ErrHashMismatch (and discarding the temp file) otherwise. It holds
+// lockFor(id, key) for its whole duration, so concurrent writes to the
+// same content-address serialize instead of racing on the same tmp dir.
+func (b *FSBackend) atomicWrite(id string, key string, writeTo func(dst io.Writer) (int64, error)) (int64, error) {
+	lock := b.lockFor(id, key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	transform, err := b.transformFunc()
+	if err != nil {
+		return 0, err
+	}
+	pathKey := transform(key)
+
+	root, err := b.diskRoot()
+	if err != nil {
+		return 0, err
+	}
+
+	tmpDir := fmt.Sprintf("/%s/%s/tmp", root, id)
+	if err := os.MkdirAll(tmpDir, os.ModePerm); err != nil {
+		return 0, err
+	}
+
+	tmpFile, err := os.CreateTemp(tmpDir, "blob-*")
+	if err != nil {
+		return 0, err
+	}
+	tmpPath := tmpFile.Name()
+
+	compressor := b.compressor()
+	algoID, ok := compressorID(compressor)
+	if !ok {
+		tmpFile.Close()
+		os.Remove(tmpPath)
+		return 0, fmt.Errorf("atomic write: unregistered compressor %q", compressor.Name())
+	}
+
+	// Reserve space for the header; it's rewritten in place once the
+	// plaintext size is known, after the compressed body is flushed.
+	if _, err := tmpFile.Write(make([]byte, compressionHeaderLen)); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpPath)
+		return 0, err
+	}
+
+	compressWriter := compressor.Compress(tmpFile)
+	hasher := b.verifyHashFunc(transform)()
+	n, err := writeTo(io.MultiWriter(compressWriter, hasher))
+	if err != nil {
+		compressWriter.Close()
+		tmpFile.Close()
+		os.Remove(tmpPath)
+		return 0, err
+	}
+	if err := compressWriter.Close(); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpPath)
+		return 0, err
+	}
+
+	if _, err := tmpFile.WriteAt(encodeCompressionHeader(algoID, n), 0); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpPath)
+		return 0, err
+	}
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpPath)
+		return 0, err
+	}
+
+	if b.shouldVerifyWrite(transform) {
+		if digest := hex.EncodeToString(hasher.Sum(nil)); digest != key {
+			os.Remove(tmpPath)
+			return 0, ErrHashMismatch
+		}
+	}
+
+	pathNameWithRoot := fmt.Sprintf("/%s/%s/%s", root, id, pathKey.Pathname)
+	if err := os.MkdirAll(pathNameWithRoot, os.ModePerm); err != nil {
+		os.Remove(tmpPath)
+		return 0, err
+	}
+
+	fullPathWithRoot := fmt.Sprintf("/%s/%s/%s", root, id, pathKey.FullPath())
+	if err := os.Rename(tmpPath, fullPathWithRoot); err != nil {
+		os.Remove(tmpPath)
+		return 0, err
+	}
+
+	return n, nil
+}
+
+func (b *FSBackend) Write(id string, key string, reader io.Reader) (int64, error) {
+	return b.atomicWrite(id, key, func(dst io.Writer) (int64, error) {
+		return io.Copy(dst, reader)
+	})
+}
+
+func (b *FSBackend) readStream(id string, key string) (int64, io.Reader, error) {
+	lock := b.lockFor(id, key)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	transform, err := b.transformFunc()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	root, err := b.diskRoot()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	pathKey := transform(key)
+	fullPathWithRoot := fmt.Sprintf("/%s/%s/%s", root, id, pathKey.FullPath())
+
+	f, err := os.Open(fullPathWithRoot)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	header := make([]byte, compressionHeaderLen)
+	if _, err := io.ReadFull(f, header); err != nil {
+		f.Close()
+		return 0, nil, err
+	}
+
+	algoID, origSize, err := decodeCompressionHeader(header)
+	if err != nil {
+		f.Close()
+		return 0, nil, err
+	}
+
+	compressor, ok := compressorByID(algoID)
+	if !ok {
+		f.Close()
+		return 0, nil, fmt.Errorf("read: unknown compressor id %d", algoID)
+	}
+
+	reader, err := compressor.Decompress(f)
+	if err != nil {
+		f.Close()
+		return 0, nil, err
+	}
+
+	closers := []io.Closer{f}
+	if rc, ok := reader.(io.Closer); ok {
+		closers = append([]io.Closer{rc}, closers...)
+	}
+
+	return origSize, &multiCloser{Reader: reader, closers: closers}, nil
+}
+
+func (b *FSBackend) Read(id string, key string) (int64, io.Reader, error) {
+	return b.readStream(id, key)
+}
+
+func (b *FSBackend) Delete(id string, key string) error {
+	transform, err := b.transformFunc()
+	if err != nil {
+		return err
+	}
+
+	pathKey := transform(key)
+
+	defer func() {
+		log.Printf("deleted [%s] from disk", pathKey.Filename)
+	}()
+
+	root, err := b.diskRoot()
+	if err != nil {
+		return err
+	}
+
+	firstPathnameWithRoot := fmt.Sprintf("%s/%s/%s", root, id, pathKey.FirstPathName())
+
+	return os.RemoveAll(firstPathnameWithRoot)
+}
+
+func (b *FSBackend) WriteDecrypt(encKey []byte, id string, key string, r io.Reader) (int64, error) {
+	return b.atomicWrite(id, key, func(dst io.Writer) (int64, error) {
+		n, err := copyDecrypt(encKey, r, dst)
+		return int64(n), err
+	})
+}
+
+// Verify re-reads the stored blob at key and recomputes its digest,
+// returning ErrHashMismatch if the content on disk no longer hashes to
+// the key it's stored under.
+func (b *FSBackend) Verify(id string, key string) error {
+	transform, err := b.transformFunc()
+	if err != nil {
+		return err
+	}
+
+	_, r, err := b.Read(id, key)
+	if err != nil {
+		return err
+	}
+	if rc, ok := r.(io.Closer); ok {
+		defer rc.Close()
+	}
+
+	return verifyDigest(r, key, b.verifyHashFunc(transform))
+}
+
+// refDir and refPath lay refs out at <root>/<id>/refs/<name>, alongside
+// but never inside the CAS-sharded content tree, so listing or clearing
+// refs never touches blob data.
+func (b *FSBackend) refDir(id string) (string, error) {
+	root, err := b.diskRoot()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("/%s/%s/refs", root, id), nil
+}
+
+func (b *FSBackend) refPath(id string, name string) (string, error) {
+	dir, err := b.refDir(id)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/%s", dir, name), nil
+}
+
+func (b *FSBackend) Link(id string, name string, key string) error {
+	dir, err := b.refDir(id)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	path, err := b.refPath(id, name)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(key), 0o644)
+}
+
+func (b *FSBackend) Unlink(id string, name string) error {
+	path, err := b.refPath(id, name)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrRefNotFound
+	}
+	return err
+}
+
+func (b *FSBackend) Resolve(id string, name string) (string, error) {
+	path, err := b.refPath(id, name)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrRefNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+func (b *FSBackend) ListRefs(id string) ([]string, error) {
+	dir, err := b.refDir(id)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		names = append(names, entry.Name())
+	}
+
+	return names, nil
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// ErrRepoLocked is returned when another process already holds the
+// exclusive lock on a store's Root.
+var ErrRepoLocked = errors.New("repo is locked by another process")
+
+const repoLockFileName = "repo.lock"
+
+// repoLock wraps the OS-level advisory lock acquired on
+// <root>/repo.lock. Acquiring and releasing it is platform-specific; see
+// acquireRepoLock and Unlock in lock_unix.go / lock_windows.go.
+type repoLock struct {
+	file *os.File
+}
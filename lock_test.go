@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestExclusiveStoreRejectsSecondOpener(t *testing.T) {
+	root := "network1:" + t.TempDir()
+
+	first, err := NewStore(StoreOpts{Root: root, Exclusive: true})
+	if err != nil {
+		t.Fatalf("NewStore (first): %v", err)
+	}
+	defer first.Unlock()
+
+	_, err = NewStore(StoreOpts{Root: root, Exclusive: true})
+	if !errors.Is(err, ErrRepoLocked) {
+		t.Fatalf("NewStore (second): got %v, want %v", err, ErrRepoLocked)
+	}
+
+	if err := first.Unlock(); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+
+	third, err := NewStore(StoreOpts{Root: root, Exclusive: true})
+	if err != nil {
+		t.Fatalf("NewStore (after Unlock): %v", err)
+	}
+	defer third.Unlock()
+}
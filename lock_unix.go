@@ -0,0 +1,44 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// acquireRepoLock takes an exclusive, non-blocking flock on
+// <root>/repo.lock, returning ErrRepoLocked if another process already
+// holds it.
+func acquireRepoLock(root string) (*repoLock, error) {
+	if err := os.MkdirAll(root, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(root, repoLockFileName)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, ErrRepoLocked
+		}
+		return nil, fmt.Errorf("lock %s: %w", path, err)
+	}
+
+	return &repoLock{file: f}, nil
+}
+
+func (l *repoLock) Unlock() error {
+	if err := syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN); err != nil {
+		l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
@@ -0,0 +1,48 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/windows"
+)
+
+// acquireRepoLock takes an exclusive, non-blocking lock on
+// <root>/repo.lock via LockFileEx, returning ErrRepoLocked if another
+// process already holds it.
+func acquireRepoLock(root string) (*repoLock, error) {
+	if err := os.MkdirAll(root, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(root, repoLockFileName)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	overlapped := new(windows.Overlapped)
+	flags := uint32(windows.LOCKFILE_EXCLUSIVE_LOCK | windows.LOCKFILE_FAIL_IMMEDIATELY)
+	if err := windows.LockFileEx(windows.Handle(f.Fd()), flags, 0, 1, 0, overlapped); err != nil {
+		f.Close()
+		if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+			return nil, ErrRepoLocked
+		}
+		return nil, fmt.Errorf("lock %s: %w", path, err)
+	}
+
+	return &repoLock{file: f}, nil
+}
+
+func (l *repoLock) Unlock() error {
+	overlapped := new(windows.Overlapped)
+	if err := windows.UnlockFileEx(windows.Handle(l.file.Fd()), 0, 1, 0, overlapped); err != nil {
+		l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"hash"
+	"io"
+	"sync"
+)
+
+// ErrKeyNotFound is returned by MemoryBackend when the requested key was
+// never written.
+var ErrKeyNotFound = errors.New("key not found")
+
+// MemoryBackend keeps blobs in a plain map, keyed by id and CAS path.
+// It's meant for tests, where touching disk or a real object store would
+// be overkill.
+type MemoryBackend struct {
+	PathTransformFunc PathTransformFunc
+
+	mu   sync.RWMutex
+	data map[string][]byte
+	refs map[string]map[string]string
+}
+
+func NewMemoryBackend(transformFunc PathTransformFunc) *MemoryBackend {
+	if transformFunc == nil {
+		transformFunc = DefaultPathTransformFunc
+	}
+
+	return &MemoryBackend{
+		PathTransformFunc: transformFunc,
+		data:              make(map[string][]byte),
+		refs:              make(map[string]map[string]string),
+	}
+}
+
+func (b *MemoryBackend) memKey(id string, key string) string {
+	return id + b.PathTransformFunc(key).FullPath()
+}
+
+func (b *MemoryBackend) hashFunc() func() hash.Hash {
+	return hashFuncFor(b.PathTransformFunc)
+}
+
+func (b *MemoryBackend) Has(id string, key string) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	_, ok := b.data[b.memKey(id, key)]
+	return ok
+}
+
+func (b *MemoryBackend) Write(id string, key string, r io.Reader) (int64, error) {
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := verifyIfCAS(b.PathTransformFunc, key, buf); err != nil {
+		return 0, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.data[b.memKey(id, key)] = buf
+	return int64(len(buf)), nil
+}
+
+func (b *MemoryBackend) Read(id string, key string) (int64, io.Reader, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	buf, ok := b.data[b.memKey(id, key)]
+	if !ok {
+		return 0, nil, ErrKeyNotFound
+	}
+
+	return int64(len(buf)), bytes.NewReader(buf), nil
+}
+
+func (b *MemoryBackend) Delete(id string, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.data, b.memKey(id, key))
+	return nil
+}
+
+func (b *MemoryBackend) WriteDecrypt(encKey []byte, id string, key string, r io.Reader) (int64, error) {
+	buf := new(bytes.Buffer)
+	n, err := copyDecrypt(encKey, r, buf)
+	if err != nil {
+		return int64(n), err
+	}
+
+	if err := verifyIfCAS(b.PathTransformFunc, key, buf.Bytes()); err != nil {
+		return 0, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.data[b.memKey(id, key)] = buf.Bytes()
+	return int64(n), nil
+}
+
+func (b *MemoryBackend) Verify(id string, key string) error {
+	_, r, err := b.Read(id, key)
+	if err != nil {
+		return err
+	}
+
+	return verifyDigest(r, key, hashFuncFor(b.PathTransformFunc))
+}
+
+func (b *MemoryBackend) Link(id string, name string, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.refs[id] == nil {
+		b.refs[id] = make(map[string]string)
+	}
+	b.refs[id][name] = key
+	return nil
+}
+
+func (b *MemoryBackend) Unlink(id string, name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.refs[id][name]; !ok {
+		return ErrRefNotFound
+	}
+	delete(b.refs[id], name)
+	return nil
+}
+
+func (b *MemoryBackend) Resolve(id string, name string) (string, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	key, ok := b.refs[id][name]
+	if !ok {
+		return "", ErrRefNotFound
+	}
+	return key, nil
+}
+
+func (b *MemoryBackend) ListRefs(id string) ([]string, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	names := make([]string, 0, len(b.refs[id]))
+	for name := range b.refs[id] {
+		names = append(names, name)
+	}
+	return names, nil
+}
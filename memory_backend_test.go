@@ -0,0 +1,29 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteTreeAgainstMemoryBackendIsRaceFree(t *testing.T) {
+	localPath := t.TempDir()
+	for i := 0; i < 20; i++ {
+		name := filepath.Join(localPath, "file"+string(rune('a'+i)))
+		if err := os.WriteFile(name, []byte("contents "+string(rune('a'+i))), 0o644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+
+	store, err := NewStore(StoreOpts{
+		PathTransformFunc: CASPathTransformFunc,
+		Backend:           NewMemoryBackend(CASPathTransformFunc),
+	})
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+
+	if _, err := store.WriteTree("id1", localPath); err != nil {
+		t.Fatalf("WriteTree: %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"hash"
+	"io"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// S3Backend stores blobs as objects in an S3-compatible bucket, mapping
+// id/PathKey.FullPath() onto the object key so the bucket namespace
+// mirrors the same CAS layout FSBackend uses on disk.
+type S3Backend struct {
+	Client            *minio.Client
+	Bucket            string
+	PathTransformFunc PathTransformFunc
+}
+
+func (b *S3Backend) objectKey(id string, key string) string {
+	return id + b.PathTransformFunc(key).FullPath()
+}
+
+func (b *S3Backend) hashFunc() func() hash.Hash {
+	return hashFuncFor(b.PathTransformFunc)
+}
+
+func (b *S3Backend) Has(id string, key string) bool {
+	_, err := b.Client.StatObject(context.Background(), b.Bucket, b.objectKey(id, key), minio.StatObjectOptions{})
+	return err == nil
+}
+
+func (b *S3Backend) Write(id string, key string, r io.Reader) (int64, error) {
+	buf := new(bytes.Buffer)
+	n, err := io.Copy(buf, r)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := verifyIfCAS(b.PathTransformFunc, key, buf.Bytes()); err != nil {
+		return 0, err
+	}
+
+	_, err = b.Client.PutObject(context.Background(), b.Bucket, b.objectKey(id, key), buf, n, minio.PutObjectOptions{})
+	return n, err
+}
+
+func (b *S3Backend) Read(id string, key string) (int64, io.Reader, error) {
+	obj, err := b.Client.GetObject(context.Background(), b.Bucket, b.objectKey(id, key), minio.GetObjectOptions{})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	info, err := obj.Stat()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return info.Size, obj, nil
+}
+
+func (b *S3Backend) Delete(id string, key string) error {
+	return b.Client.RemoveObject(context.Background(), b.Bucket, b.objectKey(id, key), minio.RemoveObjectOptions{})
+}
+
+func (b *S3Backend) WriteDecrypt(encKey []byte, id string, key string, r io.Reader) (int64, error) {
+	buf := new(bytes.Buffer)
+	n, err := copyDecrypt(encKey, r, buf)
+	if err != nil {
+		return int64(n), err
+	}
+
+	if err := verifyIfCAS(b.PathTransformFunc, key, buf.Bytes()); err != nil {
+		return 0, err
+	}
+
+	_, err = b.Client.PutObject(context.Background(), b.Bucket, b.objectKey(id, key), buf, int64(n), minio.PutObjectOptions{})
+	return int64(n), err
+}
+
+func (b *S3Backend) Verify(id string, key string) error {
+	_, r, err := b.Read(id, key)
+	if err != nil {
+		return err
+	}
+	if rc, ok := r.(io.Closer); ok {
+		defer rc.Close()
+	}
+
+	return verifyDigest(r, key, hashFuncFor(b.PathTransformFunc))
+}
+
+func (b *S3Backend) refObjectKey(id string, name string) string {
+	return id + "/refs/" + name
+}
+
+func (b *S3Backend) Link(id string, name string, key string) error {
+	r := strings.NewReader(key)
+	_, err := b.Client.PutObject(context.Background(), b.Bucket, b.refObjectKey(id, name), r, int64(len(key)), minio.PutObjectOptions{})
+	return err
+}
+
+func (b *S3Backend) Unlink(id string, name string) error {
+	key := b.refObjectKey(id, name)
+	if _, err := b.Client.StatObject(context.Background(), b.Bucket, key, minio.StatObjectOptions{}); err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return ErrRefNotFound
+		}
+		return err
+	}
+
+	return b.Client.RemoveObject(context.Background(), b.Bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (b *S3Backend) Resolve(id string, name string) (string, error) {
+	obj, err := b.Client.GetObject(context.Background(), b.Bucket, b.refObjectKey(id, name), minio.GetObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return "", ErrRefNotFound
+		}
+		return "", err
+	}
+	defer obj.Close()
+
+	data, err := io.ReadAll(obj)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return "", ErrRefNotFound
+		}
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+func (b *S3Backend) ListRefs(id string) ([]string, error) {
+	prefix := id + "/refs/"
+	var names []string
+	for obj := range b.Client.ListObjects(context.Background(), b.Bucket, minio.ListObjectsOptions{Prefix: prefix}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		names = append(names, strings.TrimPrefix(obj.Key, prefix))
+	}
+
+	return names, nil
+}
@@ -2,12 +2,9 @@ package main
 
 import (
 	"crypto/sha1"
-	"encoding/hex"
-	"errors"
 	"fmt"
+	"hash"
 	"io"
-	"log"
-	"os"
 	"strings"
 )
 
@@ -33,32 +30,57 @@ func (p PathKey) FullPath() string {
 	return fmt.Sprintf("/%s/%s", p.Pathname, p.Filename)
 }
 
-func CASPathTransformFunc(key string) PathKey {
-	hash := sha1.Sum([]byte(key))
-	hashStr := hex.EncodeToString(hash[:])
-
-	blockSize := 5
-	sliceLen := len(hashStr) / blockSize
-	paths := make([]string, sliceLen)
-
-	for i := 0; i < sliceLen; i++ {
-		from, to := i*blockSize, (i*blockSize)+blockSize
-		paths[i] = hashStr[from:to]
+// diskRoot strips the leading "<network-id>:" segment a Root is prefixed
+// with, returning the actual filesystem path underneath it. It errors if
+// root doesn't have that "<network-id>:<path>" shape, rather than
+// panicking on an out-of-range index.
+func diskRoot(root string) (string, error) {
+	parts := strings.SplitN(root, ":", 2)
+	if len(parts) != 2 {
+		return "", fmt.Errorf(`store root %q must have the form "<network-id>:<path>"`, root)
 	}
+	return parts[1], nil
+}
 
-	return PathKey{
-		Pathname: strings.Join(paths, "/"),
-		Filename: hashStr,
+// CASPathTransformFunc is the default sharding scheme: an 8-level-deep
+// tree of 5-hex-character directories built from a sha1 hash. It's kept
+// around for callers that don't need to tune the fan-out; see
+// NewCASPathTransformFunc for a configurable version. It's built once, at
+// package init, so its closure identity is stable enough for casOptionsFor
+// to recognize it.
+var CASPathTransformFunc = mustCASPathTransformFunc(CASPathOptions{})
+
+func mustCASPathTransformFunc(opts CASPathOptions) PathTransformFunc {
+	transform, err := NewCASPathTransformFunc(opts)
+	if err != nil {
+		panic(err)
 	}
+	return transform
 }
 
 type StoreOpts struct {
 	Root              string
 	PathTransformFunc PathTransformFunc
+	Backend           Backend
+	Compressor        Compressor
+
+	// CASOptions, when set, has NewStore build its default FSBackend with
+	// configurable CAS sharding instead of PathTransformFunc; see
+	// CASPathOptions and FSBackend.CASOptions.
+	CASOptions *CASPathOptions
+
+	// Exclusive has NewStore take the repo-level lock on Root before
+	// returning, failing with ErrRepoLocked if another process already
+	// holds it.
+	Exclusive bool
 }
 
+// Store is the CAS-facing API; it stores no blobs itself and forwards
+// every blob operation to whichever Backend the caller configured (disk,
+// S3, memory, ...), so operators can pick a backend via config alone.
 type Store struct {
 	StoreOpts
+	repoLock *repoLock
 }
 
 func DefaultPathTransformFunc(key string) PathKey {
@@ -68,93 +90,132 @@ func DefaultPathTransformFunc(key string) PathKey {
 	}
 }
 
-func NewStore(opts StoreOpts) *Store {
+func NewStore(opts StoreOpts) (*Store, error) {
 	if opts.PathTransformFunc == nil {
 		opts.PathTransformFunc = DefaultPathTransformFunc
 	}
 	if len(opts.Root) == 0 {
 		opts.Root = defaultRootFolderName
 	}
+	if opts.Backend == nil {
+		opts.Backend = &FSBackend{
+			Root:              opts.Root,
+			PathTransformFunc: opts.PathTransformFunc,
+			Compressor:        opts.Compressor,
+			CASOptions:        opts.CASOptions,
+		}
+	}
 
-	return &Store{
+	s := &Store{
 		StoreOpts: opts,
 	}
-}
 
-func (s *Store) Has(id string, key string) bool {
-	pathKey := s.PathTransformFunc(key)
-	root := strings.Split(s.Root, ":")[1]
-	fullPathWithRoot := fmt.Sprintf("/%s/%s/%s", root, id, pathKey.FullPath())
-
-	_, err := os.Stat(fullPathWithRoot)
-	return !errors.Is(err, os.ErrNotExist)
-}
-
-func (s *Store) openFileForWriting(id string, key string) (*os.File, error) {
-	pathKey := s.PathTransformFunc(key)
-	root := strings.Split(s.Root, ":")[1]
-	pathNameWithRoot := fmt.Sprintf("/%s/%s/%s", root, id, pathKey.Pathname)
-	if err := os.MkdirAll(pathNameWithRoot, os.ModePerm); err != nil {
-		return nil, err
+	if opts.Exclusive {
+		if err := s.Lock(); err != nil {
+			return nil, err
+		}
 	}
 
-	fullPathWithRoot := fmt.Sprintf("/%s/%s/%s", root, id, pathKey.FullPath())
-	return os.Create(fullPathWithRoot)
+	return s, nil
 }
 
-func (s *Store) writeStream(id string, key string, reader io.Reader) (int64, error) {
-	f, err := s.openFileForWriting(id, key)
-	if err != nil {
-		return 0, err
+// hashFunc returns the hash algorithm keys in this store are expected to
+// be digests under. It asks s.Backend directly (every Backend implements
+// hashFuncBackend), so it reflects whatever the backend actually in use
+// is configured with, even when that Backend was pre-built and handed to
+// NewStore via StoreOpts.Backend rather than derived from StoreOpts'
+// PathTransformFunc/CASOptions.
+func (s *Store) hashFunc() func() hash.Hash {
+	if b, ok := s.Backend.(hashFuncBackend); ok {
+		return b.hashFunc()
 	}
-	return io.Copy(f, reader)
+	return sha1.New
 }
 
-func (s *Store) Write(id string, key string, reader io.Reader) (int64, error) {
-	return s.writeStream(id, key, reader)
-}
-
-func (s *Store) readStream(id string, key string) (int64, io.Reader, error) {
-	pathKey := s.PathTransformFunc(key)
-	root := strings.Split(s.Root, ":")[1]
-	fullPathWithRoot := fmt.Sprintf("/%s/%s/%s", root, id, pathKey.FullPath())
+// Lock takes the repo-level lock on Root, backed by an OS-level lock
+// file at <root>/repo.lock, returning ErrRepoLocked if another process
+// already holds it. Calling Lock again while already held is a no-op.
+func (s *Store) Lock() error {
+	if s.repoLock != nil {
+		return nil
+	}
 
-	f, err := os.Open(fullPathWithRoot)
+	root, err := diskRoot(s.Root)
 	if err != nil {
-		return 0, nil, err
+		return err
 	}
 
-	fs, err := f.Stat()
+	lock, err := acquireRepoLock(root)
 	if err != nil {
-		return 0, nil, err
+		return err
+	}
+
+	s.repoLock = lock
+	return nil
+}
+
+// Unlock releases a lock previously taken by Lock. Calling Unlock
+// without holding the lock is a no-op.
+func (s *Store) Unlock() error {
+	if s.repoLock == nil {
+		return nil
 	}
 
-	return fs.Size(), f, nil
+	err := s.repoLock.Unlock()
+	s.repoLock = nil
+	return err
+}
+
+func (s *Store) Has(id string, key string) bool {
+	return s.Backend.Has(id, key)
+}
+
+func (s *Store) Write(id string, key string, reader io.Reader) (int64, error) {
+	return s.Backend.Write(id, key, reader)
 }
 
 func (s *Store) Read(id string, key string) (int64, io.Reader, error) {
-	return s.readStream(id, key)
+	return s.Backend.Read(id, key)
 }
 
 func (s *Store) Delete(id string, key string) error {
-	pathKey := s.PathTransformFunc(key)
+	return s.Backend.Delete(id, key)
+}
 
-	defer func() {
-		log.Printf("deleted [%s] from disk", pathKey.Filename)
-	}()
+func (s *Store) WriteDecrypt(encKey []byte, id string, key string, r io.Reader) (int64, error) {
+	return s.Backend.WriteDecrypt(encKey, id, key, r)
+}
 
-	root := strings.Split(s.Root, ":")[1]
-	firstPathnameWithRoot := fmt.Sprintf("%s/%s/%s", root, id, pathKey.FirstPathName())
+// Verify re-reads the object stored at key and recomputes its hash,
+// returning ErrHashMismatch if it no longer matches.
+func (s *Store) Verify(id string, key string) error {
+	return s.Backend.Verify(id, key)
+}
 
-	return os.RemoveAll(firstPathnameWithRoot)
+// Link publishes name as a mutable pointer at key, so future Resolve
+// calls for name return the content behind it without callers needing to
+// remember the underlying hash.
+func (s *Store) Link(id string, name string, key string) error {
+	if err := validateRefName(name); err != nil {
+		return err
+	}
+	return s.Backend.Link(id, name, key)
 }
 
-func (s *Store) WriteDecrypt(encKey []byte, id string, key string, r io.Reader) (int64, error) {
-	f, err := s.openFileForWriting(id, key)
-	if err != nil {
-		return 0, err
+func (s *Store) Unlink(id string, name string) error {
+	if err := validateRefName(name); err != nil {
+		return err
 	}
+	return s.Backend.Unlink(id, name)
+}
+
+func (s *Store) Resolve(id string, name string) (string, error) {
+	if err := validateRefName(name); err != nil {
+		return "", err
+	}
+	return s.Backend.Resolve(id, name)
+}
 
-	n, err := copyDecrypt(encKey, r, f)
-	return int64(n), err
+func (s *Store) ListRefs(id string) ([]string, error) {
+	return s.Backend.ListRefs(id)
 }
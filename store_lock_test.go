@@ -0,0 +1,16 @@
+package main
+
+import "testing"
+
+func TestNewStoreExclusiveWithUnprefixedRootReturnsError(t *testing.T) {
+	_, err := NewStore(StoreOpts{Root: defaultRootFolderName, Exclusive: true})
+	if err == nil {
+		t.Fatal("NewStore: expected error for Root without a \"<network-id>:\" prefix, got nil")
+	}
+}
+
+func TestDiskRootRejectsMissingColon(t *testing.T) {
+	if _, err := diskRoot(defaultRootFolderName); err == nil {
+		t.Fatalf("diskRoot(%q): expected error, got nil", defaultRootFolderName)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import "testing"
+
+func TestStoreLinkRejectsPathTraversalRefNames(t *testing.T) {
+	root := "network1:" + t.TempDir()
+	store, err := NewStore(StoreOpts{Root: root})
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+
+	names := []string{"../../../../tmp/gomodtest_ref_pwned.txt", "..", "", "a/b"}
+	for _, name := range names {
+		if err := store.Link("id1", name, "somekey"); err == nil {
+			t.Errorf("Link(%q): expected error, got nil", name)
+		}
+	}
+}
+
+func TestStoreResolveAndUnlinkRejectPathTraversalRefNames(t *testing.T) {
+	root := "network1:" + t.TempDir()
+	store, err := NewStore(StoreOpts{Root: root})
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+
+	if _, err := store.Resolve("id1", "../escape"); err == nil {
+		t.Error("Resolve: expected error for traversal ref name, got nil")
+	}
+	if err := store.Unlink("id1", "../escape"); err == nil {
+		t.Error("Unlink: expected error for traversal ref name, got nil")
+	}
+}
+
+func TestStoreLinkAcceptsOrdinaryRefNames(t *testing.T) {
+	root := "network1:" + t.TempDir()
+	store, err := NewStore(StoreOpts{Root: root})
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+
+	if err := store.Link("id1", "latest", "somekey"); err != nil {
+		t.Fatalf("Link: unexpected error %v", err)
+	}
+	key, err := store.Resolve("id1", "latest")
+	if err != nil {
+		t.Fatalf("Resolve: unexpected error %v", err)
+	}
+	if key != "somekey" {
+		t.Fatalf("Resolve: got %q, want %q", key, "somekey")
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestMemoryBackendVerifyUsesConfiguredHash(t *testing.T) {
+	sha256Transform, err := NewCASPathTransformFunc(CASPathOptions{HashName: "sha256"})
+	if err != nil {
+		t.Fatalf("NewCASPathTransformFunc: %v", err)
+	}
+
+	store, err := NewStore(StoreOpts{
+		PathTransformFunc: sha256Transform,
+		Backend:           NewMemoryBackend(sha256Transform),
+	})
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+
+	content := "hello world"
+	key := sha256Hex(content)
+
+	if _, err := store.Write("id1", key, strings.NewReader(content)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := store.Verify("id1", key); err != nil {
+		t.Fatalf("Verify on a sha256-CAS MemoryBackend store: got %v, want nil", err)
+	}
+}
+
+func TestFSBackendWriteRejectsWrongKeyForCASStore(t *testing.T) {
+	root := "network1:" + t.TempDir()
+	store, err := NewStore(StoreOpts{Root: root, PathTransformFunc: CASPathTransformFunc})
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+
+	if _, err := store.Write("id1", "totally-wrong-key", strings.NewReader("hello world")); err != ErrHashMismatch {
+		t.Fatalf("Write with mismatched key: got %v, want ErrHashMismatch", err)
+	}
+}
+
+func TestFSBackendWriteDoesNotVerifyNonCASStore(t *testing.T) {
+	root := "network1:" + t.TempDir()
+	store, err := NewStore(StoreOpts{Root: root})
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+
+	if _, err := store.Write("id1", "arbitrary-filename", strings.NewReader("hello world")); err != nil {
+		t.Fatalf("Write against a DefaultPathTransformFunc store: got unexpected error %v", err)
+	}
+}
+
+func TestMemoryBackendWriteRejectsWrongKeyForCASStore(t *testing.T) {
+	store, err := NewStore(StoreOpts{
+		PathTransformFunc: CASPathTransformFunc,
+		Backend:           NewMemoryBackend(CASPathTransformFunc),
+	})
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+
+	if _, err := store.Write("id1", "totally-wrong-key", strings.NewReader("hello world")); err != ErrHashMismatch {
+		t.Fatalf("Write with mismatched key: got %v, want ErrHashMismatch", err)
+	}
+}
+
+func TestMemoryBackendWriteDoesNotVerifyNonCASStore(t *testing.T) {
+	store, err := NewStore(StoreOpts{Backend: NewMemoryBackend(nil)})
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+
+	if _, err := store.Write("id1", "arbitrary-filename", strings.NewReader("hello world")); err != nil {
+		t.Fatalf("Write against a DefaultPathTransformFunc store: got unexpected error %v", err)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// maxParallelTreeFiles bounds how many files WriteTree/ReadTree stream
+// concurrently, so a large directory doesn't open hundreds of file
+// descriptors (or backend connections) at once.
+const maxParallelTreeFiles = 5
+
+// treeEntry is one file's record in a WriteTree manifest.
+type treeEntry struct {
+	RelPath string      `json:"relPath"`
+	Mode    os.FileMode `json:"mode"`
+	Size    int64       `json:"size"`
+	Key     string      `json:"key"`
+}
+
+// WriteTree walks localPath, writing every regular file it finds as its
+// own content-addressed blob (keyed by its digest under the store's
+// configured hash, see Store.hashFunc), then writes a manifest
+// blob listing {relPath, mode, size, key} for each file. The manifest's
+// own key is returned so ReadTree can later reconstruct the directory.
+func (s *Store) WriteTree(id string, localPath string) (string, error) {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, maxParallelTreeFiles)
+		entries []treeEntry
+		errCh   = make(chan error, 1)
+	)
+
+	reportErr := func(err error) {
+		select {
+		case errCh <- err:
+		default:
+		}
+	}
+
+	walkErr := filepath.Walk(localPath, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(localPath, path)
+		if err != nil {
+			return err
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				reportErr(err)
+				return
+			}
+
+			h := s.hashFunc()()
+			h.Write(data)
+			key := hex.EncodeToString(h.Sum(nil))
+
+			if _, err := s.Write(id, key, bytes.NewReader(data)); err != nil {
+				reportErr(err)
+				return
+			}
+
+			mu.Lock()
+			entries = append(entries, treeEntry{
+				RelPath: relPath,
+				Mode:    info.Mode(),
+				Size:    info.Size(),
+				Key:     key,
+			})
+			mu.Unlock()
+		}()
+
+		return nil
+	})
+
+	wg.Wait()
+	if walkErr != nil {
+		return "", walkErr
+	}
+
+	select {
+	case err := <-errCh:
+		return "", err
+	default:
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].RelPath < entries[j].RelPath })
+
+	manifest, err := json.Marshal(entries)
+	if err != nil {
+		return "", err
+	}
+
+	manifestHash := s.hashFunc()()
+	manifestHash.Write(manifest)
+	manifestKey := hex.EncodeToString(manifestHash.Sum(nil))
+
+	if _, err := s.Write(id, manifestKey, bytes.NewReader(manifest)); err != nil {
+		return "", err
+	}
+
+	return manifestKey, nil
+}
+
+// ReadTree fetches the manifest at manifestKey and recreates the
+// directory it describes under destPath, streaming each entry's blob
+// back out through Read.
+func (s *Store) ReadTree(id string, manifestKey string, destPath string) error {
+	_, r, err := s.Read(id, manifestKey)
+	if err != nil {
+		return err
+	}
+	if rc, ok := r.(io.Closer); ok {
+		defer rc.Close()
+	}
+
+	manifest, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	var entries []treeEntry
+	if err := json.Unmarshal(manifest, &entries); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := validateTreeRelPath(entry.RelPath); err != nil {
+			return err
+		}
+	}
+
+	var (
+		wg    sync.WaitGroup
+		sem   = make(chan struct{}, maxParallelTreeFiles)
+		errCh = make(chan error, 1)
+	)
+
+	for _, entry := range entries {
+		entry := entry
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := s.writeTreeFile(id, destPath, entry); err != nil {
+				select {
+				case errCh <- err:
+				default:
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	select {
+	case err := <-errCh:
+		return err
+	default:
+		return nil
+	}
+}
+
+// validateTreeRelPath rejects a manifest entry's RelPath if it could
+// escape destPath once joined onto it: this manifest is untrusted data
+// fetched from the CAS by key (e.g. via peer replication), so an entry
+// like "../../../../tmp/evil" must be caught before writeTreeFile ever
+// builds a path from it.
+func validateTreeRelPath(relPath string) error {
+	if relPath == "" || filepath.IsAbs(relPath) {
+		return fmt.Errorf("tree manifest: invalid relPath %q", relPath)
+	}
+
+	cleaned := filepath.Clean(relPath)
+	if cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("tree manifest: relPath %q escapes the destination directory", relPath)
+	}
+
+	return nil
+}
+
+func (s *Store) writeTreeFile(id string, destPath string, entry treeEntry) error {
+	_, r, err := s.Read(id, entry.Key)
+	if err != nil {
+		return err
+	}
+	if rc, ok := r.(io.Closer); ok {
+		defer rc.Close()
+	}
+
+	fullPath := filepath.Join(destPath, entry.RelPath)
+	if err := os.MkdirAll(filepath.Dir(fullPath), os.ModePerm); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(fullPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, entry.Mode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, r)
+	return err
+}
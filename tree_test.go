@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadTreeRejectsPathTraversalManifestEntries(t *testing.T) {
+	root := "network1:" + t.TempDir()
+	store, err := NewStore(StoreOpts{Root: root})
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+
+	evilRelPath := "../../../../tmp/evil"
+	manifest, err := json.Marshal([]treeEntry{
+		{RelPath: evilRelPath, Mode: 0o644, Size: 4, Key: "deadbeef"},
+	})
+	if err != nil {
+		t.Fatalf("marshal manifest: %v", err)
+	}
+
+	manifestKey := "manifest-key"
+	if _, err := store.Write("id1", manifestKey, bytes.NewReader(manifest)); err != nil {
+		t.Fatalf("Write manifest: %v", err)
+	}
+
+	destPath := t.TempDir()
+	evilPath := filepath.Join(destPath, evilRelPath)
+	if err := store.ReadTree("id1", manifestKey, destPath); err == nil {
+		t.Fatal("ReadTree: expected error for manifest with path-traversal RelPath, got nil")
+	}
+
+	if _, err := os.Stat(evilPath); !os.IsNotExist(err) {
+		t.Fatalf("ReadTree wrote outside destPath: %s exists", evilPath)
+	}
+}
+
+func TestWriteTreeRoundTripsOnNonDefaultHashStore(t *testing.T) {
+	root := "network1:" + t.TempDir()
+	casOptions := &CASPathOptions{HashName: "sha256", Depth: 2, DirNameLen: 2}
+	store, err := NewStore(StoreOpts{Root: root, CASOptions: casOptions})
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+
+	localPath := t.TempDir()
+	if err := os.WriteFile(filepath.Join(localPath, "hello.txt"), []byte("hello world"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	manifestKey, err := store.WriteTree("id1", localPath)
+	if err != nil {
+		t.Fatalf("WriteTree: %v", err)
+	}
+
+	destPath := t.TempDir()
+	if err := store.ReadTree("id1", manifestKey, destPath); err != nil {
+		t.Fatalf("ReadTree: %v", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(destPath, "hello.txt"))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if string(got) != "hello world" {
+		t.Fatalf("got %q, want %q", got, "hello world")
+	}
+}
+
+func TestWriteTreeRoundTripsOnPreBuiltNonDefaultHashBackend(t *testing.T) {
+	sha256Transform, err := NewCASPathTransformFunc(CASPathOptions{HashName: "sha256"})
+	if err != nil {
+		t.Fatalf("NewCASPathTransformFunc: %v", err)
+	}
+
+	// A pre-built Backend handed to NewStore directly, with no matching
+	// StoreOpts.PathTransformFunc/CASOptions set: WriteTree must still key
+	// content with the hash this backend actually verifies against.
+	store, err := NewStore(StoreOpts{Backend: NewMemoryBackend(sha256Transform)})
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+
+	localPath := t.TempDir()
+	if err := os.WriteFile(filepath.Join(localPath, "hello.txt"), []byte("hello world"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	manifestKey, err := store.WriteTree("id1", localPath)
+	if err != nil {
+		t.Fatalf("WriteTree: %v", err)
+	}
+
+	destPath := t.TempDir()
+	if err := store.ReadTree("id1", manifestKey, destPath); err != nil {
+		t.Fatalf("ReadTree: %v", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(destPath, "hello.txt"))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if string(got) != "hello world" {
+		t.Fatalf("got %q, want %q", got, "hello world")
+	}
+}